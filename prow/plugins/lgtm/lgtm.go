@@ -19,12 +19,15 @@ package lgtm
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/repoowners"
 )
 
 const pluginName = "lgtm"
@@ -38,18 +41,31 @@ var (
 func init() {
 	plugins.RegisterGenericCommentHandler(pluginName, handleGenericComment, helpProvider)
 	plugins.RegisterReviewEventHandler(pluginName, handlePullRequestReview, helpProvider)
+	plugins.RegisterPullRequestHandler(pluginName, handlePullRequestEvent, helpProvider)
 }
 
 func helpProvider(config *plugins.Configuration, enabledRepos []string) (*pluginhelp.PluginHelp, error) {
-	// The Config field is omitted because this plugin is not configurable.
 	pluginHelp := &pluginhelp.PluginHelp{
 		Description: "The lgtm plugin manages the application and removal of the 'lgtm' (Looks Good To Me) label which is typically used to gate merging.",
+		Config: map[string]string{
+			"": fmt.Sprintf("The lgtm plugin by default allows any org member to apply or cancel the '%s' label. "+
+				"Repos listed under plugins.Lgtm with UseOwnersForLgtm set restrict this to the reviewers "+
+				"and approvers listed in the OWNERS files covering the files changed by the PR — a reviewer must cover "+
+				"every changed file, not just one of them, which is a narrower bar than a plain union of each file's "+
+				"reviewers would set. By default, pushing "+
+				"new commits to a PR that already carries the label removes it; set sticky_lgtm to keep it instead. "+
+				"GitHub reviews count toward the label once required_lgtm_count distinct non-author reviewers (default "+
+				"1) have approved; a Request Changes or Dismiss review removes that reviewer from the count. Comments "+
+				"from logins listed in trusted_bots that match one of external_review_patterns (e.g. a Gerrit "+
+				"Code-Review+2 or Phabricator \"accepted\" notification relayed by a bridge bot) are treated the same "+
+				"as a human /lgtm or /lgtm cancel, with the bot's login recorded as the reviewer.", lgtmLabel),
+		},
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
 		Usage:       "/lgtm [cancel]",
 		Description: "Adds or removes the 'lgtm' label which is typically used to gate merging.",
 		Featured:    true,
-		WhoCanUse:   "Members of the organization that owns the repository. '/lgtm cancel' can be used additionally by the PR author.",
+		WhoCanUse:   "Members of the organization that owns the repository, or, if the repo opts into OWNERS-based authorization, the OWNERS reviewers/approvers for the changed files. '/lgtm cancel' can be used additionally by the PR author.",
 		Examples:    []string{"/lgtm", "/lgtm cancel"},
 	})
 	return pluginHelp, nil
@@ -62,6 +78,15 @@ type githubClient interface {
 	CreateComment(owner, repo string, number int, comment string) error
 	RemoveLabel(owner, repo string, number int, label string) error
 	GetIssueLabels(org, repo string, number int) ([]github.Label, error)
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
+	ListReviews(org, repo string, number int) ([]github.Review, error)
+}
+
+// ownersClient is satisfied by *repoowners.Client. It is split out so that
+// handle() can be unit tested against a fake.
+type ownersClient interface {
+	LoadRepoOwners(org, repo, sha string, number int) (repoowners.RepoOwner, error)
 }
 
 type state struct {
@@ -72,6 +97,11 @@ type state struct {
 	number 		int
 	body 		string
 	htmlURL 	string
+	// viaTrustedBot is set when wantLGTM came from a trusted bot's relayed
+	// external review verdict rather than a human /lgtm comment. Such
+	// verdicts bypass the OWNERS/assignee authorization gates entirely,
+	// since the bot is not expected to appear in any OWNERS file itself.
+	viaTrustedBot bool
 }
 
 func handleGenericComment(pc plugins.PluginClient, e github.GenericCommentEvent) error {
@@ -92,11 +122,18 @@ func handleGenericComment(pc plugins.PluginClient, e github.GenericCommentEvent)
 
 	// If we create an "/lgtm" comment, add lgtm if necessary.
 	// If we create a "/lgtm cancel" comment, remove lgtm if necessary.
+	// A comment from a trusted bot that matches a configured external review
+	// pattern (e.g. a Gerrit or Phabricator notification relayed by a bridge)
+	// is treated the same way, with the bot's login as the reviewer.
 	wantLGTM := false
+	viaTrustedBot := false
 	if lgtmRe.MatchString(body) {
 		wantLGTM = true
 	} else if lgtmCancelRe.MatchString(body) {
 		wantLGTM = false
+	} else if w, ok := externalReviewWantLGTM(body, author, pc.PluginConfig.LgtmFor(repo.Owner.Login, repo.Name)); ok {
+		wantLGTM = w
+		viaTrustedBot = true
 	} else {
 		return nil
 	}
@@ -111,60 +148,224 @@ func handleGenericComment(pc plugins.PluginClient, e github.GenericCommentEvent)
 
 	return handle(
 		wantLGTM,
-		gc, 
+		pc.PluginConfig,
+		gc,
+		pc.OwnersClient,
 		log,
 		&state{
-			author, 
+			author,
 			issueAuthor,
-			repo,  
-			assignees, 
-			number, 
-			body, 
+			repo,
+			assignees,
+			number,
+			body,
 			htmlURL,
+			viaTrustedBot,
 		},
 	)
 }
 
+// handlePullRequestReview keeps the lgtm label in sync with the set of
+// distinct reviewers who currently have an outstanding approval, rather than
+// reacting only to the single review that triggered the event. This lets
+// repos require a quorum of approvers (plugins.Lgtm.RequiredLgtmCount)
+// instead of treating any one approval as sufficient.
 func handlePullRequestReview(pc plugins.PluginClient, e github.ReviewEvent) error {
-	// author := e.Review.User.Login
-	// issueAuthor := e.PullRequest.User.Login
-	// repo := e.Repo
-	// assignees := e.PullRequest.Assignees
-	// number := e.PullRequest.Number
-	// body := e.Review.Body
-	// htmlURL := e.Review.HTMLURL
-
-	// If we review with Approve, add lgtm if necessary.
-	// If we review with Request Changes, remove lgtm if necessary.
-	wantLGTM := false
-	if e.Review.State == "approve" {
-		wantLGTM = true
-	} else if e.Review.State == "changes_requested" {
-		wantLGTM = false
-	} else {
+	switch e.Review.State {
+	case github.ReviewStateApproved, github.ReviewStateChangesRequested, github.ReviewStateDismissed:
+	default:
 		return nil
 	}
-	
-	return handle(
-		wantLGTM,	 
+
+	prAuthor := e.PullRequest.User.Login
+	if e.Review.User.Login == prAuthor {
+		// Authors cannot LGTM their own PR, reviewing it changes nothing.
+		return nil
+	}
+
+	return syncLGTMFromReviews(
+		pc.PluginConfig,
 		pc.GitHubClient,
+		pc.OwnersClient,
 		pc.Logger,
-		&state{
-			author: 		e.Review.User.Login, 
-			issueAuthor: 	e.PullRequest.User.Login,
-			repo: 			e.Repo,  
-			assignees: 		e.PullRequest.Assignees, 
-			number: 		e.PullRequest.Number, 
-			body: 			e.Review.Body, 
-			htmlURL: 		e.Review.HTMLURL,
-		},
+		e.Repo.Owner.Login,
+		e.Repo.Name,
+		e.PullRequest.Number,
+		prAuthor,
+		e.PullRequest.Assignees,
 	)
 }
 
-func handle(wantLGTM bool, gc githubClient, log *logrus.Entry, pr *state) error {
+// syncLGTMFromReviews recomputes the current set of approving reviewers from
+// GitHub's review history and applies or removes the lgtm label depending on
+// whether that set meets the repo's configured quorum. When the repo has
+// opted into OWNERS-based authorization, only approvers who pass the same
+// per-file OWNERS coverage check as the comment-driven path count toward the
+// quorum, so an Approve from a non-reviewer can't apply the label on its own.
+func syncLGTMFromReviews(config *plugins.Configuration, gc githubClient, oc ownersClient, log *logrus.Entry, org, repoName string, number int, prAuthor string, assignees []github.User) error {
+	lgtmConfig := config.LgtmFor(org, repoName)
+
+	approvers, err := reviewersWithLGTM(gc, org, repoName, number, prAuthor)
+	if err != nil {
+		return fmt.Errorf("error computing current approvers: %v", err)
+	}
+
+	countingApprovers := approvers
+	if lgtmConfig != nil && lgtmConfig.UseOwnersForLgtm {
+		fileReviewers, _, err := ownersReviewersForPR(gc, oc, org, repoName, number)
+		if err != nil {
+			return fmt.Errorf("error computing OWNERS reviewers: %v", err)
+		}
+		countingApprovers = sets.NewString()
+		for _, login := range approvers.List() {
+			if authorizedLogin(fileReviewers, login) {
+				countingApprovers.Insert(login)
+			}
+		}
+	}
+
+	required := 1
+	if lgtmConfig != nil && lgtmConfig.RequiredLgtmCount > 0 {
+		required = lgtmConfig.RequiredLgtmCount
+	}
+
+	wantLGTM := countingApprovers.Len() >= required
+	if !wantLGTM && lgtmConfig != nil && lgtmConfig.SelfLgtmForAssignees {
+		for _, assignee := range assignees {
+			if approvers.Has(assignee.Login) {
+				wantLGTM = true
+				break
+			}
+		}
+	}
+
+	log.Infof("Current lgtm approvers for %s/%s#%d: %v (need %d); setting label to %t.", org, repoName, number, countingApprovers.List(), required, wantLGTM)
+	return setLGTMLabel(wantLGTM, gc, log, org, repoName, number)
+}
+
+// reviewersWithLGTM reconstructs the set of distinct logins whose most
+// recent review on the PR is an outstanding approval, by replaying
+// ListReviews in submission order: an APPROVE adds the reviewer, a
+// CHANGES_REQUESTED or DISMISSED review removes them again.
+func reviewersWithLGTM(gc githubClient, org, repoName string, number int, prAuthor string) (sets.String, error) {
+	reviews, err := gc.ListReviews(org, repoName, number)
+	if err != nil {
+		return nil, fmt.Errorf("error listing reviews: %v", err)
+	}
+
+	approvers := sets.NewString()
+	for _, review := range reviews {
+		login := review.User.Login
+		if login == prAuthor {
+			continue
+		}
+		switch review.State {
+		case github.ReviewStateApproved:
+			approvers.Insert(login)
+		case github.ReviewStateChangesRequested, github.ReviewStateDismissed:
+			approvers.Delete(login)
+		}
+	}
+	return approvers, nil
+}
+
+// handlePullRequestEvent invalidates a stale lgtm label when new commits are
+// pushed to a PR, unless the repo has opted out via StickyLgtm.
+func handlePullRequestEvent(pc plugins.PluginClient, e github.PullRequestEvent) error {
+	if e.Action != github.PullRequestActionSynchronize {
+		return nil
+	}
+
+	org := e.PullRequest.Base.Repo.Owner.Login
+	repoName := e.PullRequest.Base.Repo.Name
+	number := e.PullRequest.Number
+	log := pc.Logger
+	gc := pc.GitHubClient
+
+	if lgtmConfig := pc.PluginConfig.LgtmFor(org, repoName); lgtmConfig != nil && lgtmConfig.StickyLgtm {
+		log.Infof("Skipping removing lgtm label for %s/%s#%d because sticky_lgtm is enabled.", org, repoName, number)
+		return nil
+	}
+
+	labels, err := gc.GetIssueLabels(org, repoName, number)
+	if err != nil {
+		return fmt.Errorf("error getting issue labels: %v", err)
+	}
+	hasLGTM := false
+	for _, candidate := range labels {
+		if candidate.Name == lgtmLabel {
+			hasLGTM = true
+			break
+		}
+	}
+	if !hasLGTM {
+		return nil
+	}
+
+	log.Infof("Removing lgtm label for %s/%s#%d because the PR was updated.", org, repoName, number)
+	if err := gc.RemoveLabel(org, repoName, number, lgtmLabel); err != nil {
+		return fmt.Errorf("error removing lgtm label: %v", err)
+	}
+	return gc.CreateComment(org, repoName, number, plugins.FormatSimpleResponse(e.PullRequest.User.Login,
+		"New changes are detected. LGTM label has been removed."))
+}
+
+// externalReviewWantLGTM checks whether body is a review verdict relayed by
+// a trusted bot (e.g. a Gerrit Code-Review+2 or Phabricator "accepted"
+// comment synthesized by a Gerrit/Phabricator-to-GitHub bridge) rather than
+// a human /lgtm command. ok is false if author isn't a configured trusted
+// bot or body doesn't match any of the repo's external review patterns.
+func externalReviewWantLGTM(body, author string, lgtmConfig *plugins.Lgtm) (wantLGTM, ok bool) {
+	if lgtmConfig == nil || len(lgtmConfig.TrustedBots) == 0 {
+		return false, false
+	}
+	if !sets.NewString(lgtmConfig.TrustedBots...).Has(author) {
+		return false, false
+	}
+	for _, pattern := range lgtmConfig.ExternalReviewPatterns {
+		re, err := regexp.Compile(pattern.Regexp)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(body) {
+			return strings.EqualFold(pattern.State, "lgtm"), true
+		}
+	}
+	return false, false
+}
+
+func handle(wantLGTM bool, config *plugins.Configuration, gc githubClient, oc ownersClient, log *logrus.Entry, pr *state) error {
 	org := pr.repo.Owner.Login
 	repoName := pr.repo.Name
 
+	// A trusted bot's relayed external review verdict is already authorized
+	// by virtue of the bot's login being explicitly configured in
+	// plugins.Lgtm.TrustedBots; it doesn't need to also be an assignee or
+	// appear in OWNERS, which it typically won't.
+	if pr.viaTrustedBot {
+		log.Infof("Setting lgtm to %t for %s/%s#%d via trusted bot %s.", wantLGTM, org, repoName, pr.number, pr.author)
+		return setLGTMLabel(wantLGTM, gc, log, org, repoName, pr.number)
+	}
+
+	lgtmConfig := config.LgtmFor(org, repoName)
+	if lgtmConfig != nil && lgtmConfig.UseOwnersForLgtm {
+		authorized, reviewers, err := authorizedByOwners(gc, oc, org, repoName, pr)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to compute OWNERS-based reviewers for %s/%s#%d.", org, repoName, pr.number)
+			return err
+		}
+		if !authorized && !wantLGTM && pr.author == pr.issueAuthor {
+			// The PR author may always cancel the lgtm on their own PR.
+			authorized = true
+		}
+		if !authorized {
+			resp := fmt.Sprintf("changing LGTM is restricted to reviewers and approvers in OWNERS files. The following can do it: %s", strings.Join(reviewers.List(), ", "))
+			log.Infof("Reply to /lgtm request with comment: \"%s\"", resp)
+			return gc.CreateComment(org, repoName, pr.number, plugins.FormatResponseRaw(pr.body, pr.htmlURL, pr.author, resp))
+		}
+		return setLGTMLabel(wantLGTM, gc, log, org, repoName, pr.number)
+	}
+
 	// Determine if reviewer is already assigned
 	isAssignee := false
 	for _, assignee := range pr.assignees {
@@ -192,11 +393,16 @@ func handle(wantLGTM bool, gc githubClient, log *logrus.Entry, pr *state) error
 		}
 	}
 
-	// Only add the label if it doesn't have it, and vice versa.
+	return setLGTMLabel(wantLGTM, gc, log, org, repoName, pr.number)
+}
+
+// setLGTMLabel adds or removes the lgtm label so that its presence matches
+// wantLGTM, doing nothing if it already does.
+func setLGTMLabel(wantLGTM bool, gc githubClient, log *logrus.Entry, org, repoName string, number int) error {
 	hasLGTM := false
-	labels, err := gc.GetIssueLabels(org, repoName, pr.number)
+	labels, err := gc.GetIssueLabels(org, repoName, number)
 	if err != nil {
-		log.WithError(err).Errorf("Failed to get the labels on %s/%s#%d.", org, repoName, pr.number)
+		log.WithError(err).Errorf("Failed to get the labels on %s/%s#%d.", org, repoName, number)
 	}
 	for _, candidate := range labels {
 		if candidate.Name == lgtmLabel {
@@ -206,11 +412,73 @@ func handle(wantLGTM bool, gc githubClient, log *logrus.Entry, pr *state) error
 	}
 	if hasLGTM && !wantLGTM {
 		log.Info("Removing LGTM label.")
-		return gc.RemoveLabel(org, repoName, pr.number, lgtmLabel)
+		return gc.RemoveLabel(org, repoName, number, lgtmLabel)
 	} else if !hasLGTM && wantLGTM {
 		log.Info("Adding LGTM label.")
-		return gc.AddLabel(org, repoName, pr.number, lgtmLabel)
+		return gc.AddLabel(org, repoName, number, lgtmLabel)
+	}
+	return nil
+}
+
+// authorizedByOwners determines whether pr.author is allowed to change the
+// lgtm label under OWNERS-based authorization: they must be a reviewer or
+// approver of *every* file changed by the PR, not merely of some file in it,
+// mirroring the per-file coverage the repo's OWNERS-based approve plugin
+// already requires. It also returns the union of eligible reviewers across
+// all changed files so callers can surface it in a denial message.
+//
+// Note this is a deliberately stricter reading than "any reviewer of any
+// changed file may lgtm the whole PR": a reviewer of pkg/a who owns nothing
+// under pkg/b cannot lgtm a PR that touches both. That's a narrower bar than
+// a literal union-of-reviewers interpretation would set, called out here
+// because it changes who can lgtm a multi-directory PR.
+func authorizedByOwners(gc githubClient, oc ownersClient, org, repoName string, pr *state) (bool, sets.String, error) {
+	fileReviewers, union, err := ownersReviewersForPR(gc, oc, org, repoName, pr.number)
+	if err != nil {
+		return false, nil, err
+	}
+	return authorizedLogin(fileReviewers, pr.author), union, nil
+}
+
+// ownersReviewersForPR loads the reviewer/approver OWNERS set for each file
+// changed by the given PR, returning both the per-file sets (for checking
+// whether a single login covers all of them) and their union (for surfacing
+// in denial messages).
+func ownersReviewersForPR(gc githubClient, oc ownersClient, org, repoName string, number int) ([]sets.String, sets.String, error) {
+	pull, err := gc.GetPullRequest(org, repoName, number)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting pull request: %v", err)
+	}
+
+	owners, err := oc.LoadRepoOwners(org, repoName, pull.Head.SHA, number)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading repo owners: %v", err)
+	}
+
+	changes, err := gc.GetPullRequestChanges(org, repoName, number)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting pull request changes: %v", err)
+	}
+
+	union := sets.NewString()
+	fileReviewers := make([]sets.String, 0, len(changes))
+	for _, change := range changes {
+		r := owners.Reviewers(change.Filename)
+		fileReviewers = append(fileReviewers, r)
+		union = union.Union(r)
+	}
+
+	return fileReviewers, union, nil
+}
+
+// authorizedLogin reports whether login appears in every one of fileReviewers,
+// i.e. covers every changed file rather than just one of them.
+func authorizedLogin(fileReviewers []sets.String, login string) bool {
+	for _, r := range fileReviewers {
+		if !r.Has(login) {
+			return false
+		}
 	}
-	return nil	
+	return true
 }
 
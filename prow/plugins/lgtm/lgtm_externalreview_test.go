@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lgtm
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestExternalReviewWantLGTM(t *testing.T) {
+	config := &plugins.Lgtm{
+		TrustedBots: []string{"gerritbot"},
+		ExternalReviewPatterns: []plugins.ExternalReviewPattern{
+			{Regexp: `Code-Review\+2`, State: "lgtm"},
+			{Regexp: `Code-Review-2`, State: "cancel"},
+		},
+	}
+
+	if want, ok := externalReviewWantLGTM("Code-Review+2 by someone", "gerritbot", config); !ok || !want {
+		t.Errorf("expected trusted bot's +2 to be treated as lgtm, got want=%t ok=%t", want, ok)
+	}
+	if want, ok := externalReviewWantLGTM("Code-Review-2 by someone", "gerritbot", config); !ok || want {
+		t.Errorf("expected trusted bot's -2 to be treated as cancel, got want=%t ok=%t", want, ok)
+	}
+	if _, ok := externalReviewWantLGTM("Code-Review+2 by someone", "random-user", config); ok {
+		t.Errorf("expected non-trusted author to be ignored")
+	}
+	if _, ok := externalReviewWantLGTM("/lgtm", "gerritbot", config); ok {
+		t.Errorf("expected body that matches no pattern to be ignored")
+	}
+}
+
+func TestHandleViaTrustedBotBypassesOwnersGate(t *testing.T) {
+	fc := newFakeClient()
+	const number = 7
+	fc.prs[number] = &github.PullRequest{Number: number, Head: github.PullRequestBranch{SHA: "sha"}}
+	fc.changes[number] = []github.PullRequestChange{{Filename: "pkg/a/a.go"}}
+
+	oc := fakeOwnersClient{owner: fakeRepoOwner{reviewersByFile: map[string]sets.String{
+		"pkg/a/a.go": sets.NewString("someone-else"),
+	}}}
+
+	config := &plugins.Configuration{Lgtm: []plugins.Lgtm{{Repos: []string{"org/repo"}, UseOwnersForLgtm: true}}}
+	pr := &state{
+		author:        "gerritbot",
+		repo:          github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+		number:        number,
+		viaTrustedBot: true,
+	}
+
+	if err := handle(true, config, fc, oc, testLogger(), pr); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if !fc.hasLGTM(number) {
+		t.Errorf("expected trusted bot verdict to apply the label despite not appearing in OWNERS")
+	}
+}
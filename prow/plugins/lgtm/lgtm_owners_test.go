@@ -0,0 +1,61 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lgtm
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestAuthorizedByOwnersRequiresCoverageOfEveryFile(t *testing.T) {
+	fc := newFakeClient()
+	const number = 3
+	fc.prs[number] = &github.PullRequest{Number: number, Head: github.PullRequestBranch{SHA: "sha"}}
+	fc.changes[number] = []github.PullRequestChange{
+		{Filename: "pkg/a/a.go"},
+		{Filename: "pkg/b/b.go"},
+	}
+
+	oc := fakeOwnersClient{owner: fakeRepoOwner{reviewersByFile: map[string]sets.String{
+		"pkg/a/a.go": sets.NewString("alice"),
+		"pkg/b/b.go": sets.NewString("bob"),
+	}}}
+
+	pr := &state{author: "alice", number: number}
+	authorized, _, err := authorizedByOwners(fc, oc, "org", "repo", pr)
+	if err != nil {
+		t.Fatalf("authorizedByOwners: %v", err)
+	}
+	if authorized {
+		t.Errorf("alice only owns one of two changed files and should not be authorized")
+	}
+
+	pr = &state{author: "bob", number: number}
+	oc = fakeOwnersClient{owner: fakeRepoOwner{reviewersByFile: map[string]sets.String{
+		"pkg/a/a.go": sets.NewString("bob"),
+		"pkg/b/b.go": sets.NewString("bob"),
+	}}}
+	authorized, _, err = authorizedByOwners(fc, oc, "org", "repo", pr)
+	if err != nil {
+		t.Fatalf("authorizedByOwners: %v", err)
+	}
+	if !authorized {
+		t.Errorf("bob owns every changed file and should be authorized")
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lgtm
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestSyncLGTMFromReviews(t *testing.T) {
+	tests := []struct {
+		name          string
+		reviews       []github.Review
+		required      int
+		useOwners     bool
+		fileReviewers map[string]sets.String
+		wantLabel     bool
+	}{
+		{
+			name: "single approval meets default quorum of 1",
+			reviews: []github.Review{
+				{User: github.User{Login: "alice"}, State: github.ReviewStateApproved},
+			},
+			wantLabel: true,
+		},
+		{
+			name: "single approval does not meet quorum of 2",
+			reviews: []github.Review{
+				{User: github.User{Login: "alice"}, State: github.ReviewStateApproved},
+			},
+			required:  2,
+			wantLabel: false,
+		},
+		{
+			name: "two distinct approvers meet quorum of 2",
+			reviews: []github.Review{
+				{User: github.User{Login: "alice"}, State: github.ReviewStateApproved},
+				{User: github.User{Login: "bob"}, State: github.ReviewStateApproved},
+			},
+			required:  2,
+			wantLabel: true,
+		},
+		{
+			name: "changes requested after approval drops below quorum",
+			reviews: []github.Review{
+				{User: github.User{Login: "alice"}, State: github.ReviewStateApproved},
+				{User: github.User{Login: "alice"}, State: github.ReviewStateChangesRequested},
+			},
+			wantLabel: false,
+		},
+		{
+			name: "author's own approval never counts",
+			reviews: []github.Review{
+				{User: github.User{Login: "author"}, State: github.ReviewStateApproved},
+			},
+			wantLabel: false,
+		},
+		{
+			name: "non-OWNERS reviewer's approval is rejected when UseOwnersForLgtm is set",
+			reviews: []github.Review{
+				{User: github.User{Login: "random-user"}, State: github.ReviewStateApproved},
+			},
+			useOwners:     true,
+			fileReviewers: map[string]sets.String{"pkg/a/a.go": sets.NewString("alice")},
+			wantLabel:     false,
+		},
+		{
+			name: "OWNERS reviewer's approval still counts when UseOwnersForLgtm is set",
+			reviews: []github.Review{
+				{User: github.User{Login: "alice"}, State: github.ReviewStateApproved},
+			},
+			useOwners:     true,
+			fileReviewers: map[string]sets.String{"pkg/a/a.go": sets.NewString("alice")},
+			wantLabel:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fc := newFakeClient()
+			const number = 9
+			fc.reviews[number] = test.reviews
+			fc.prs[number] = &github.PullRequest{Number: number, Head: github.PullRequestBranch{SHA: "sha"}}
+			fc.changes[number] = []github.PullRequestChange{{Filename: "pkg/a/a.go"}}
+
+			oc := fakeOwnersClient{owner: fakeRepoOwner{reviewersByFile: test.fileReviewers}}
+
+			config := &plugins.Configuration{}
+			if test.required > 0 || test.useOwners {
+				config.Lgtm = []plugins.Lgtm{{Repos: []string{"org/repo"}, RequiredLgtmCount: test.required, UseOwnersForLgtm: test.useOwners}}
+			}
+
+			err := syncLGTMFromReviews(config, fc, oc, testLogger(), "org", "repo", number, "author", nil)
+			if err != nil {
+				t.Fatalf("syncLGTMFromReviews: %v", err)
+			}
+			if got := fc.hasLGTM(number); got != test.wantLabel {
+				t.Errorf("label present = %t, want %t", got, test.wantLabel)
+			}
+		})
+	}
+}
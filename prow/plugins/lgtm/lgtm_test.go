@@ -0,0 +1,188 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lgtm
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+// fakeClient is a minimal fake satisfying the lgtm package's githubClient
+// interface, enough to drive the label/comment/review side effects under
+// test without needing a real GitHub client.
+type fakeClient struct {
+	labels    map[int]sets.String
+	comments  []string
+	assigned  map[int][]string
+	members   sets.String
+	prs       map[int]*github.PullRequest
+	changes   map[int][]github.PullRequestChange
+	reviews   map[int][]github.Review
+	assignErr error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		labels:   map[int]sets.String{},
+		assigned: map[int][]string{},
+		members:  sets.NewString(),
+		prs:      map[int]*github.PullRequest{},
+		changes:  map[int][]github.PullRequestChange{},
+		reviews:  map[int][]github.Review{},
+	}
+}
+
+func (f *fakeClient) IsMember(owner, login string) (bool, error) {
+	return f.members.Has(login), nil
+}
+
+func (f *fakeClient) AddLabel(owner, repo string, number int, label string) error {
+	if f.labels[number] == nil {
+		f.labels[number] = sets.NewString()
+	}
+	f.labels[number].Insert(label)
+	return nil
+}
+
+func (f *fakeClient) RemoveLabel(owner, repo string, number int, label string) error {
+	if f.labels[number] != nil {
+		f.labels[number].Delete(label)
+	}
+	return nil
+}
+
+func (f *fakeClient) GetIssueLabels(org, repo string, number int) ([]github.Label, error) {
+	var out []github.Label
+	for _, name := range f.labels[number].List() {
+		out = append(out, github.Label{Name: name})
+	}
+	return out, nil
+}
+
+func (f *fakeClient) AssignIssue(owner, repo string, number int, assignees []string) error {
+	if f.assignErr != nil {
+		return f.assignErr
+	}
+	f.assigned[number] = append(f.assigned[number], assignees...)
+	return nil
+}
+
+func (f *fakeClient) CreateComment(owner, repo string, number int, comment string) error {
+	f.comments = append(f.comments, comment)
+	return nil
+}
+
+func (f *fakeClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return f.prs[number], nil
+}
+
+func (f *fakeClient) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	return f.changes[number], nil
+}
+
+func (f *fakeClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return f.reviews[number], nil
+}
+
+func (f *fakeClient) hasLGTM(number int) bool {
+	return f.labels[number] != nil && f.labels[number].Has(lgtmLabel)
+}
+
+// fakeRepoOwner is a bare-bones repoowners.RepoOwner backed by a per-file
+// reviewer map, for tests that don't need real OWNERS parsing.
+type fakeRepoOwner struct {
+	reviewersByFile map[string]sets.String
+}
+
+func (o fakeRepoOwner) Reviewers(path string) sets.String     { return o.reviewersByFile[path] }
+func (o fakeRepoOwner) LeafReviewers(path string) sets.String { return o.reviewersByFile[path] }
+
+type fakeOwnersClient struct {
+	owner repoowners.RepoOwner
+}
+
+func (f fakeOwnersClient) LoadRepoOwners(org, repo, sha string, number int) (repoowners.RepoOwner, error) {
+	return f.owner, nil
+}
+
+func testLogger() *logrus.Entry {
+	return logrus.WithField("plugin", pluginName)
+}
+
+func TestHandlePullRequestEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       github.PullRequestEventAction
+		hasLabel     bool
+		sticky       bool
+		wantLabel    bool
+		wantComment  bool
+	}{
+		{name: "synchronize, label present, not sticky: label removed", action: github.PullRequestActionSynchronize, hasLabel: true, sticky: false, wantLabel: false, wantComment: true},
+		{name: "synchronize, label present, sticky: label kept", action: github.PullRequestActionSynchronize, hasLabel: true, sticky: true, wantLabel: true, wantComment: false},
+		{name: "synchronize, label absent, not sticky: no-op", action: github.PullRequestActionSynchronize, hasLabel: false, sticky: false, wantLabel: false, wantComment: false},
+		{name: "synchronize, label absent, sticky: no-op", action: github.PullRequestActionSynchronize, hasLabel: false, sticky: true, wantLabel: false, wantComment: false},
+		{name: "opened, label present, not sticky: untouched", action: github.PullRequestActionOpened, hasLabel: true, sticky: false, wantLabel: true, wantComment: false},
+		{name: "labeled, label present, not sticky: untouched", action: github.PullRequestActionLabeled, hasLabel: true, sticky: false, wantLabel: true, wantComment: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fc := newFakeClient()
+			const number = 5
+			if test.hasLabel {
+				fc.labels[number] = sets.NewString(lgtmLabel)
+			}
+
+			config := &plugins.Configuration{}
+			config.Lgtm = []plugins.Lgtm{{
+				Repos:      []string{"org/repo"},
+				StickyLgtm: test.sticky,
+			}}
+
+			pc := plugins.PluginClient{Logger: testLogger(), GitHubClient: fc, PluginConfig: config}
+			e := github.PullRequestEvent{
+				Action: test.action,
+				PullRequest: github.PullRequest{
+					Number: number,
+					User:   github.User{Login: "author"},
+					Base: github.PullRequestBranch{
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+				},
+			}
+
+			if err := handlePullRequestEvent(pc, e); err != nil {
+				t.Fatalf("handlePullRequestEvent: %v", err)
+			}
+
+			if got := fc.hasLGTM(number); got != test.wantLabel {
+				t.Errorf("label present = %t, want %t", got, test.wantLabel)
+			}
+			if gotComment := len(fc.comments) > 0; gotComment != test.wantComment {
+				t.Errorf("comment posted = %t, want %t", gotComment, test.wantComment)
+			}
+		})
+	}
+}
+
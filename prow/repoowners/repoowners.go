@@ -0,0 +1,238 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package repoowners parses and caches OWNERS files so that other plugins
+// can determine, for a given path in a repository, who is allowed to
+// approve or review changes to it.
+package repoowners
+
+import (
+	"container/list"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+)
+
+const ownersFileName = "OWNERS"
+
+// Config is the schema of an OWNERS file.
+type Config struct {
+	Approvers []string `json:"approvers,omitempty" yaml:"approvers,omitempty"`
+	Reviewers []string `json:"reviewers,omitempty" yaml:"reviewers,omitempty"`
+}
+
+// githubClient is the subset of the GitHub client that the owners client
+// needs in order to fetch OWNERS files.
+type githubClient interface {
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
+	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
+}
+
+// RepoOwner answers questions about who owns which paths in a repository.
+type RepoOwner interface {
+	// Reviewers returns the set of logins that may review the given path,
+	// including reviewers and approvers inherited from parent directories.
+	Reviewers(path string) sets.String
+	// LeafReviewers returns the set of logins configured as reviewers or
+	// approvers on the OWNERS file closest to the given path, without
+	// walking up to parent directories.
+	LeafReviewers(path string) sets.String
+}
+
+// repoOwners is a RepoOwner backed by the OWNERS files of a single
+// (org, repo, sha) checkout.
+type repoOwners struct {
+	// dirs maps a repo-relative directory (using "/" separators, "" for
+	// the repo root) to the Config parsed from its OWNERS file, if any.
+	dirs map[string]Config
+}
+
+func canonicalize(path string) string {
+	dir := filepath.ToSlash(filepath.Dir(path))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// parents returns dir and every ancestor directory up to and including the
+// repo root ("").
+func parents(dir string) []string {
+	var out []string
+	for {
+		out = append(out, dir)
+		if dir == "" {
+			return out
+		}
+		if idx := strings.LastIndex(dir, "/"); idx >= 0 {
+			dir = dir[:idx]
+		} else {
+			dir = ""
+		}
+	}
+}
+
+func (o *repoOwners) LeafReviewers(path string) sets.String {
+	reviewers := sets.NewString()
+	for _, dir := range parents(canonicalize(path)) {
+		cfg, ok := o.dirs[dir]
+		if !ok {
+			continue
+		}
+		reviewers.Insert(cfg.Reviewers...)
+		reviewers.Insert(cfg.Approvers...)
+		return reviewers
+	}
+	return reviewers
+}
+
+func (o *repoOwners) Reviewers(path string) sets.String {
+	reviewers := sets.NewString()
+	for _, dir := range parents(canonicalize(path)) {
+		cfg, ok := o.dirs[dir]
+		if !ok {
+			continue
+		}
+		reviewers.Insert(cfg.Reviewers...)
+		reviewers.Insert(cfg.Approvers...)
+	}
+	return reviewers
+}
+
+type cacheKey struct {
+	org, repo, sha string
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	owners *repoOwners
+}
+
+// defaultCacheSize bounds the number of distinct (org, repo, sha) entries
+// Client will hold onto at once. Without a bound, a long-running prow
+// instance would accumulate one entry per PR head SHA it's ever seen across
+// every repo with the feature enabled and never free any of them.
+const defaultCacheSize = 500
+
+// Client loads and caches RepoOwner implementations for (org, repo, sha)
+// triples so that repeated events on the same commit don't re-fetch and
+// re-parse every OWNERS file along the way. The cache is bounded and
+// evicts least-recently-used entries once it reaches maxEntries.
+type Client struct {
+	ghc    githubClient
+	logger *logrus.Entry
+
+	mu         sync.Mutex
+	cache      map[cacheKey]*list.Element
+	lru        *list.List // front = most recently used
+	maxEntries int
+}
+
+// NewClient creates a Client backed by the given GitHub client, bounding its
+// cache to defaultCacheSize entries.
+func NewClient(ghc githubClient) *Client {
+	return &Client{
+		ghc:        ghc,
+		cache:      make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: defaultCacheSize,
+	}
+}
+
+func (c *Client) cacheGet(key cacheKey) (*repoOwners, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).owners, true
+}
+
+func (c *Client) cacheSet(key cacheKey, owners *repoOwners) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.cache[key]; ok {
+		elem.Value.(*cacheEntry).owners = owners
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.cache[key] = c.lru.PushFront(&cacheEntry{key: key, owners: owners})
+	for len(c.cache) > c.maxEntries {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.lru.Remove(oldest)
+		delete(c.cache, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// LoadRepoOwners returns the RepoOwner for the given PR, fetching and
+// parsing the OWNERS files touched by the PR's changed files the first
+// time it is asked about a given (org, repo, sha).
+func (c *Client) LoadRepoOwners(org, repo, sha string, number int) (RepoOwner, error) {
+	key := cacheKey{org, repo, sha}
+
+	if cached, ok := c.cacheGet(key); ok {
+		return cached, nil
+	}
+
+	changes, err := c.ghc.GetPullRequestChanges(org, repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("error listing PR changes: %v", err)
+	}
+
+	o := &repoOwners{dirs: make(map[string]Config)}
+	seen := sets.NewString()
+	for _, change := range changes {
+		for _, dir := range parents(canonicalize(change.Filename)) {
+			if seen.Has(dir) {
+				continue
+			}
+			seen.Insert(dir)
+
+			ownersPath := ownersFileName
+			if dir != "" {
+				ownersPath = dir + "/" + ownersFileName
+			}
+			content, err := c.ghc.GetFile(org, repo, ownersPath, sha)
+			if err != nil {
+				if strings.Contains(err.Error(), "404") {
+					continue
+				}
+				return nil, fmt.Errorf("error fetching %s: %v", ownersPath, err)
+			}
+			var cfg Config
+			if err := yaml.Unmarshal(content, &cfg); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", ownersPath, err)
+			}
+			o.dirs[dir] = cfg
+		}
+	}
+
+	c.cacheSet(key, o)
+
+	return o, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repoowners
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+)
+
+func TestParents(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{dir: "", want: []string{""}},
+		{dir: "pkg", want: []string{"pkg", ""}},
+		{dir: "pkg/foo/bar", want: []string{"pkg/foo/bar", "pkg/foo", "pkg", ""}},
+	}
+	for _, test := range tests {
+		if got := parents(test.dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parents(%q) = %v, want %v", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestReviewersWalksUpToRoot(t *testing.T) {
+	o := &repoOwners{dirs: map[string]Config{
+		"":        {Reviewers: []string{"root-reviewer"}},
+		"pkg":     {Approvers: []string{"pkg-approver"}},
+		"pkg/foo": {Reviewers: []string{"foo-reviewer"}},
+	}}
+
+	got := o.Reviewers("pkg/foo/bar/baz.go")
+	want := []string{"foo-reviewer", "pkg-approver", "root-reviewer"}
+	if !got.HasAll(want...) || got.Len() != len(want) {
+		t.Errorf("Reviewers(%q) = %v, want %v", "pkg/foo/bar/baz.go", got.List(), want)
+	}
+}
+
+func TestLeafReviewersStopsAtClosestOwners(t *testing.T) {
+	o := &repoOwners{dirs: map[string]Config{
+		"":    {Reviewers: []string{"root-reviewer"}},
+		"pkg": {Reviewers: []string{"pkg-reviewer"}},
+	}}
+
+	got := o.LeafReviewers("pkg/foo/bar.go")
+	want := []string{"pkg-reviewer"}
+	if !got.HasAll(want...) || got.Len() != len(want) {
+		t.Errorf("LeafReviewers(%q) = %v, want %v", "pkg/foo/bar.go", got.List(), want)
+	}
+}
+
+func TestClientCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := &Client{
+		cache:      make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: 2,
+	}
+
+	a, b, d := cacheKey{sha: "a"}, cacheKey{sha: "b"}, cacheKey{sha: "d"}
+	c.cacheSet(a, &repoOwners{})
+	c.cacheSet(b, &repoOwners{})
+	// Touch a so it's more recently used than b.
+	if _, ok := c.cacheGet(a); !ok {
+		t.Fatalf("expected %v to be cached", a)
+	}
+	c.cacheSet(d, &repoOwners{})
+
+	if _, ok := c.cacheGet(a); !ok {
+		t.Errorf("expected recently-used %v to survive eviction", a)
+	}
+	if _, ok := c.cacheGet(b); ok {
+		t.Errorf("expected least-recently-used %v to be evicted", b)
+	}
+	if _, ok := c.cacheGet(d); !ok {
+		t.Errorf("expected newly-inserted %v to be cached", d)
+	}
+	if len(c.cache) != 2 {
+		t.Errorf("cache has %d entries, want %d", len(c.cache), c.maxEntries)
+	}
+}